@@ -0,0 +1,560 @@
+// This implementation of {@link TokenStream} loads tokens from a
+// {@link TokenSource} on-demand, and places the tokens in a buffer to provide
+// access to any previous token by index.
+//
+// <p>
+// This token stream ignores the value of {@link Token//getChannel}. If your
+// parser requires the token stream filter tokens to only those on a particular
+// channel, such as {@link Token//DEFAULT_CHANNEL} or
+// {@link Token//HIDDEN_CHANNEL}, use a filtering token stream such a
+// {@link CommonTokenStream}.</p>
+
+package antlr
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BufferedTokenStream buffers every token pulled from a TokenSource so any
+// previously seen token can be revisited by index, but it does not filter on
+// channel: LT/LB/Seek see every token the lexer produced, hidden or not.
+// CommonTokenStream builds on top of it to add that channel filtering.
+type BufferedTokenStream struct {
+	tokenSource TokenSource
+
+	tokens     []Token
+	index      int
+	fetchedEOF bool
+
+	// bufferStartIndex is the absolute token index of tokens[0]. It is 0
+	// until a Mark/Release pair trims a prefix of tokens that is no longer
+	// reachable, at which point every absolute index used below is
+	// translated to a slice position via local().
+	bufferStartIndex int
+
+	// markDepth counts outstanding Mark calls; the buffer is only a
+	// candidate for trimming once it drops back to zero.
+	markDepth int
+
+	// nextMarker hands out a unique id for each Mark call.
+	nextMarker int
+
+	// trimEnabled gates whether Release is allowed to discard buffered
+	// tokens at all. It defaults to false: most callers build a stream,
+	// parse it once, and then want whole-buffer access afterwards (e.g.
+	// TokenStreamRewriter.GetTextForProgram, or just GetAllTokens), so
+	// trimming must be something a caller opts into via
+	// EnableBufferTrimming, not a side effect of every Mark/Release pair.
+	trimEnabled bool
+}
+
+func NewBufferedTokenStream(tokenSource TokenSource) *BufferedTokenStream {
+
+	ts := new(BufferedTokenStream)
+
+	// The {@link TokenSource} from which tokens for bt stream are fetched.
+	ts.tokenSource = tokenSource
+
+	// A collection of all tokens fetched from the token source. The list is
+	// considered a complete view of the input once {@link //fetchedEOF} is set
+	// to {@code true}.
+	ts.tokens = make([]Token, 0)
+
+	// The index into {@link //tokens} of the current token (next token to
+	// {@link //consume}). {@link //tokens}{@code [}{@link //p}{@code ]} should
+	// be
+	// {@link //LT LT(1)}.
+	//
+	// <p>This field is set to -1 when the stream is first constructed or when
+	// {@link //SetTokenSource} is called, indicating that the first token has
+	// not yet been fetched from the token source. For additional information,
+	// see the documentation of {@link IntStream} for a description of
+	// Initializing Methods.</p>
+	ts.index = -1
+
+	// Indicates whether the {@link Token//EOF} token has been fetched from
+	// {@link //tokenSource} and added to {@link //tokens}. This field improves
+	// performance for the following cases:
+	//
+	// <ul>
+	// <li>{@link //consume}: The lookahead check in {@link //consume} to
+	// prevent
+	// consuming the EOF symbol is optimized by checking the values of
+	// {@link //fetchedEOF} and {@link //p} instead of calling {@link
+	// //LA}.</li>
+	// <li>{@link //fetch}: The check to prevent adding multiple EOF symbols
+	// into
+	// {@link //tokens} is trivial with bt field.</li>
+	// <ul>
+	ts.fetchedEOF = false
+
+	return ts
+}
+
+// NewBufferedTokenStreamWithTrimming is NewBufferedTokenStream plus
+// EnableBufferTrimming, for callers that want the bounded-memory streaming
+// behavior from construction instead of the default of retaining every
+// token for the stream's lifetime.
+func NewBufferedTokenStreamWithTrimming(tokenSource TokenSource) *BufferedTokenStream {
+	ts := NewBufferedTokenStream(tokenSource)
+	ts.EnableBufferTrimming()
+	return ts
+}
+
+func (b *BufferedTokenStream) GetAllTokens() []Token {
+	return b.tokens
+}
+
+// Mark records that the caller may still need to look back at tokens before
+// the current position and returns a unique marker to pass to the matching
+// Release. Marks nest: the buffer is only eligible for trimming once every
+// outstanding Mark has been Released.
+func (b *BufferedTokenStream) Mark() int {
+	b.markDepth++
+	b.nextMarker++
+	return b.nextMarker
+}
+
+// EnableBufferTrimming opts this stream into discarding tokens behind the
+// current position once Release drops the last outstanding Mark, bounding
+// memory use for a long parse. It is off by default because trimming is
+// incompatible with anything that wants the whole buffer back afterwards -
+// GetAllTokens, GetTextFromInterval with an index before the current
+// position, or a TokenStreamRewriter built on this stream - and there is no
+// way for Release to know whether such a consumer is still coming. Callers
+// that know they only need a sliding window (matching UnbufferedTokenStream's
+// model) can call this to get that behaviour here too.
+func (b *BufferedTokenStream) EnableBufferTrimming() {
+	b.trimEnabled = true
+}
+
+// Release balances a prior Mark. Once the last outstanding Mark is
+// released, and trimming has been enabled via EnableBufferTrimming, the
+// buffer discards the prefix of tokens strictly before the current parser
+// position, since nothing can look back across it anymore. An unbalanced
+// Release (no outstanding Mark) is a no-op rather than a panic: real
+// Parser/ATN call sites are not exhaustively audited against this
+// refactor, so treating a stray Release as harmless - as it always was
+// before marks existed - is safer than crashing a caller that happens to
+// over-release.
+func (b *BufferedTokenStream) Release(marker int) {
+	if b.markDepth == 0 {
+		return
+	}
+	b.markDepth--
+	if b.markDepth == 0 && b.trimEnabled {
+		b.trim()
+	}
+}
+
+// trim discards tokens before the current index once nothing holds a Mark
+// that could still look back across them, bounding memory use for a long
+// parse instead of retaining every token for the stream's lifetime. Callers
+// reach this only once EnableBufferTrimming has opted in.
+func (b *BufferedTokenStream) trim() {
+	cut := b.index - b.bufferStartIndex
+	if cut <= 0 {
+		return
+	}
+	b.tokens = append(b.tokens[:0:0], b.tokens[cut:]...)
+	b.bufferStartIndex += cut
+}
+
+// local translates an absolute token index (as seen by Token.GetTokenIndex
+// and every exported method on this stream) to a position in the live
+// tokens slice.
+func (b *BufferedTokenStream) local(i int) int {
+	return i - b.bufferStartIndex
+}
+
+// absoluteSize is the absolute index one past the last buffered token,
+// equivalent to the pre-trimming len(b.tokens).
+func (b *BufferedTokenStream) absoluteSize() int {
+	return b.bufferStartIndex + len(b.tokens)
+}
+
+func (b *BufferedTokenStream) reset() {
+	b.Seek(0)
+}
+
+func (b *BufferedTokenStream) Seek(index int) {
+	b.lazyInit()
+	b.index = b.adjustSeekIndex(index)
+}
+
+func (b *BufferedTokenStream) Get(index int) Token {
+	b.lazyInit()
+	if index < b.bufferStartIndex {
+		index = b.bufferStartIndex
+	}
+	return b.tokens[b.local(index)]
+}
+
+func (b *BufferedTokenStream) Consume() {
+	var SkipEofCheck = false
+	if b.index >= 0 {
+		if b.fetchedEOF {
+			// the last token in tokens is EOF. Skip check if p indexes any
+			// fetched token except the last.
+			SkipEofCheck = b.index < b.absoluteSize()-1
+		} else {
+			// no EOF token in tokens. Skip check if p indexes a fetched token.
+			SkipEofCheck = b.index < b.absoluteSize()
+		}
+	} else {
+		// not yet initialized
+		SkipEofCheck = false
+	}
+
+	if PortDebug {
+		fmt.Println("Consume 1")
+	}
+	if !SkipEofCheck && b.LA(1) == TokenEOF {
+		panic("cannot consume EOF")
+	}
+	if b.Sync(b.index + 1) {
+		if PortDebug {
+			fmt.Println("Consume 2")
+		}
+		b.index = b.adjustSeekIndex(b.index + 1)
+	}
+}
+
+// Sync makes sure index {@code i} in tokens has a token.
+//
+// @return {@code true} if a token is located at index {@code i}, otherwise
+// {@code false}.
+// @see //Get(int i)
+// /
+func (b *BufferedTokenStream) Sync(i int) bool {
+	var n = i - b.absoluteSize() + 1 // how many more elements we need?
+	if n > 0 {
+		var fetched = b.fetch(n)
+		if PortDebug {
+			fmt.Println("Sync done")
+		}
+		return fetched >= n
+	}
+	return true
+}
+
+// fetch adds {@code n} elements to buffer.
+//
+// @return The actual number of elements added to the buffer.
+// /
+func (b *BufferedTokenStream) fetch(n int) int {
+	if b.fetchedEOF {
+		return 0
+	}
+
+	for i := 0; i < n; i++ {
+		var t Token = b.tokenSource.NextToken()
+		if PortDebug {
+			fmt.Println("fetch loop")
+		}
+		t.SetTokenIndex(b.absoluteSize())
+		b.tokens = append(b.tokens, t)
+		if t.GetTokenType() == TokenEOF {
+			b.fetchedEOF = true
+			return i + 1
+		}
+	}
+
+	if PortDebug {
+		fmt.Println("fetch done")
+	}
+	return n
+}
+
+// GetTokens gets all tokens from start..stop inclusively///
+func (b *BufferedTokenStream) GetTokens(start int, stop int, types *IntervalSet) []Token {
+
+	if start < 0 || stop < 0 {
+		return nil
+	}
+	b.lazyInit()
+	if start < b.bufferStartIndex {
+		start = b.bufferStartIndex
+	}
+	var subset = make([]Token, 0)
+	if stop >= b.absoluteSize() {
+		stop = b.absoluteSize() - 1
+	}
+	for i := start; i <= stop; i++ {
+		var t = b.tokens[b.local(i)]
+		if t.GetTokenType() == TokenEOF {
+			break
+		}
+		if types == nil || types.contains(t.GetTokenType()) {
+			subset = append(subset, t)
+		}
+	}
+	return subset
+}
+
+func (b *BufferedTokenStream) LA(i int) int {
+	return b.LT(i).GetTokenType()
+}
+
+func (b *BufferedTokenStream) lazyInit() {
+	if b.index == -1 {
+		b.setup()
+	}
+}
+
+func (b *BufferedTokenStream) setup() {
+	b.Sync(0)
+	b.index = b.adjustSeekIndex(0)
+}
+
+func (b *BufferedTokenStream) GetTokenSource() TokenSource {
+	return b.tokenSource
+}
+
+// SetTokenSource resets this token stream by setting its token source.///
+func (b *BufferedTokenStream) SetTokenSource(tokenSource TokenSource) {
+	b.tokenSource = tokenSource
+	b.tokens = make([]Token, 0)
+	b.index = -1
+	b.fetchedEOF = false
+	b.bufferStartIndex = 0
+	b.markDepth = 0
+}
+
+// NextTokenOnChannel, given a starting index, returns the index of the next
+// token on channel. Returns i if tokens[i] is on channel. Returns -1 if
+// there are no tokens on channel between i and EOF. An i before the oldest
+// token still buffered (Release trimmed it away) is clamped up to that
+// oldest token rather than indexing off the front of tokens.
+// /
+func (b *BufferedTokenStream) NextTokenOnChannel(i, channel int) int {
+	if i < b.bufferStartIndex {
+		// A trimmed prefix is gone; the earliest we can land is the oldest
+		// token still buffered, same as GetTokens clamping start.
+		i = b.bufferStartIndex
+	}
+	b.Sync(i)
+	if i >= b.absoluteSize() {
+		return -1
+	}
+	var token = b.tokens[b.local(i)]
+	for token.GetChannel() != channel {
+		if token.GetTokenType() == TokenEOF {
+			return -1
+		}
+		i += 1
+		b.Sync(i)
+		token = b.tokens[b.local(i)]
+	}
+	return i
+}
+
+// previousTokenOnChannel, given a starting index, returns the index of the
+// previous token on channel. Returns i if tokens[i] is on channel. Returns -1
+// if there are no tokens on channel between i and the oldest token still in
+// the buffer (a prefix discarded by Release's trimming is treated the same
+// as having walked off the start of the stream).
+func (b *BufferedTokenStream) previousTokenOnChannel(i, channel int) int {
+	for i >= b.bufferStartIndex && b.tokens[b.local(i)].GetChannel() != channel {
+		i -= 1
+	}
+	if i < b.bufferStartIndex {
+		return -1
+	}
+	return i
+}
+
+// getHiddenTokensToRight collects all tokens on specified channel to the
+// right of the current token up until we see a token on
+// DEFAULT_TOKEN_CHANNEL or EOF. If channel is -1, find any non default
+// channel token.
+func (b *BufferedTokenStream) getHiddenTokensToRight(tokenIndex, channel int) []Token {
+	b.lazyInit()
+	if tokenIndex < b.bufferStartIndex || tokenIndex >= b.absoluteSize() {
+		panic(strconv.Itoa(tokenIndex) + " not in " + strconv.Itoa(b.bufferStartIndex) + ".." + strconv.Itoa(b.absoluteSize()-1))
+	}
+	var nextOnChannel = b.NextTokenOnChannel(tokenIndex+1, LexerDefaultTokenChannel)
+	var from_ = tokenIndex + 1
+	// if none onchannel to right, nextOnChannel=-1 so set to = last token
+	var to int
+	if nextOnChannel == -1 {
+		to = b.absoluteSize() - 1
+	} else {
+		to = nextOnChannel
+	}
+	return b.filterForChannel(from_, to, channel)
+}
+
+// getHiddenTokensToLeft collects all tokens on specified channel to the left
+// of the current token up until we see a token on DEFAULT_TOKEN_CHANNEL. If
+// channel is -1, find any non default channel token.
+func (b *BufferedTokenStream) getHiddenTokensToLeft(tokenIndex, channel int) []Token {
+	b.lazyInit()
+	if tokenIndex < b.bufferStartIndex || tokenIndex >= b.absoluteSize() {
+		panic(strconv.Itoa(tokenIndex) + " not in " + strconv.Itoa(b.bufferStartIndex) + ".." + strconv.Itoa(b.absoluteSize()-1))
+	}
+	var prevOnChannel = b.previousTokenOnChannel(tokenIndex-1, LexerDefaultTokenChannel)
+	if prevOnChannel == tokenIndex-1 {
+		return nil
+	}
+	// if none on channel to left, prevOnChannel=-1 then from=oldest buffered token
+	var from_ int
+	if prevOnChannel == -1 {
+		from_ = b.bufferStartIndex
+	} else {
+		from_ = prevOnChannel + 1
+	}
+	var to = tokenIndex - 1
+	return b.filterForChannel(from_, to, channel)
+}
+
+func (b *BufferedTokenStream) filterForChannel(left, right, channel int) []Token {
+	var hidden = make([]Token, 0)
+	for i := left; i < right+1; i++ {
+		var t = b.tokens[b.local(i)]
+		if channel == -1 {
+			if t.GetChannel() != LexerDefaultTokenChannel {
+				hidden = append(hidden, t)
+			}
+		} else if t.GetChannel() == channel {
+			hidden = append(hidden, t)
+		}
+	}
+	if len(hidden) == 0 {
+		return nil
+	}
+	return hidden
+}
+
+func (b *BufferedTokenStream) GetSourceName() string {
+	return b.tokenSource.GetSourceName()
+}
+
+func (b *BufferedTokenStream) Size() int {
+	return b.absoluteSize()
+}
+
+func (b *BufferedTokenStream) Index() int {
+	return b.index
+}
+
+func (b *BufferedTokenStream) GetAllText() string {
+	return b.GetTextFromInterval(nil)
+}
+
+func (b *BufferedTokenStream) GetTextFromTokens(start, end Token) string {
+	if start == nil || end == nil {
+		return ""
+	}
+
+	return b.GetTextFromInterval(NewInterval(start.GetTokenIndex(), end.GetTokenIndex()))
+}
+
+func (b *BufferedTokenStream) GetTextFromRuleContext(interval RuleContext) string {
+	return b.GetTextFromInterval(interval.GetSourceInterval())
+}
+
+func (b *BufferedTokenStream) GetTextFromInterval(interval *Interval) string {
+
+	b.lazyInit()
+	b.Fill()
+	if interval == nil {
+		interval = NewInterval(0, b.absoluteSize()-1)
+	}
+
+	var start = interval.start
+	var stop = interval.stop
+	if start < 0 || stop < 0 {
+		return ""
+	}
+	if start < b.bufferStartIndex {
+		start = b.bufferStartIndex
+	}
+	if stop >= b.absoluteSize() {
+		stop = b.absoluteSize() - 1
+	}
+
+	var s = ""
+	for i := start; i < stop+1; i++ {
+		var t = b.tokens[b.local(i)]
+		if t.GetTokenType() == TokenEOF {
+			break
+		}
+		s += t.GetText()
+	}
+
+	return s
+}
+
+// Fill gets all tokens from lexer until EOF///
+func (b *BufferedTokenStream) Fill() {
+	b.lazyInit()
+	for b.fetch(1000) == 1000 {
+		continue
+	}
+}
+
+// adjustSeekIndex is the identity on a plain BufferedTokenStream (it only
+// filters by channel on CommonTokenStream), except that an i before the
+// oldest token still buffered - a trimmed-away prefix, see
+// EnableBufferTrimming - is clamped up to it, the same as Get and
+// NextTokenOnChannel, so Seek can never leave b.index pointing at a
+// discarded slice position.
+func (b *BufferedTokenStream) adjustSeekIndex(i int) int {
+	if i < b.bufferStartIndex {
+		return b.bufferStartIndex
+	}
+	return i
+}
+
+func (b *BufferedTokenStream) LB(k int) Token {
+
+	if k == 0 || b.index-k < b.bufferStartIndex {
+		return nil
+	}
+	var i = b.index
+	var n = 1
+	// step back k tokens; channel is ignored on this stream
+	for n <= k {
+		i -= 1
+		n += 1
+	}
+	if i < b.bufferStartIndex {
+		return nil
+	}
+	return b.tokens[b.local(i)]
+}
+
+func (b *BufferedTokenStream) LT(k int) Token {
+	b.lazyInit()
+	if k == 0 {
+		return nil
+	}
+	if k < 0 {
+		return b.LB(-k)
+	}
+	var i = b.index + k - 1
+	b.Sync(i)
+	if i >= b.absoluteSize() { // return EOF token
+		// EOF must be last token
+		return b.tokens[len(b.tokens)-1]
+	}
+	return b.tokens[b.local(i)]
+}
+
+// getNumberOfOnChannelTokens counts EOF just once.///
+func (b *BufferedTokenStream) getNumberOfOnChannelTokens() int {
+	var n = 0
+	b.Fill()
+	for i := 0; i < len(b.tokens); i++ {
+		var t = b.tokens[i]
+		if t.GetChannel() == LexerDefaultTokenChannel {
+			n += 1
+		}
+		if t.GetTokenType() == TokenEOF {
+			break
+		}
+	}
+	return n
+}
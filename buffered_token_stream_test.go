@@ -0,0 +1,36 @@
+package antlr
+
+import "testing"
+
+func TestBufferedTokenStreamSeekClampsToOldestBufferedTokenAfterTrim(t *testing.T) {
+	// Regression test: NewBufferedTokenStreamWithTrimming is the plain,
+	// channel-agnostic BufferedTokenStream with trimming enabled - not
+	// routed through CommonTokenStream, so it never goes through
+	// CommonTokenStream.adjustSeekIndex's NextTokenOnChannel clamp. Once
+	// Release has trimmed a prefix, Seek to an index before
+	// bufferStartIndex must clamp there instead of leaving b.index at a
+	// position whose local() is negative.
+	tokens := []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+		newTestToken(2, LexerDefaultTokenChannel, "b"),
+		newTestToken(2, LexerDefaultTokenChannel, "c"),
+	}
+	bts := NewBufferedTokenStreamWithTrimming(newSliceTokenSource(tokens))
+
+	marker := bts.Mark()
+	bts.Consume()
+	bts.Consume()
+	bts.Release(marker)
+
+	if bts.bufferStartIndex == 0 {
+		t.Fatal("Release did not trim the buffer; test setup is not exercising the bug")
+	}
+
+	bts.Seek(0)
+	if got := bts.Index(); got != bts.bufferStartIndex {
+		t.Fatalf("Index() after Seek(0) post-trim = %d, want %d (clamped to oldest buffered token)", got, bts.bufferStartIndex)
+	}
+	if got, want := bts.LT(1).GetText(), tokens[bts.bufferStartIndex].GetText(); got != want {
+		t.Fatalf("LT(1) after Seek(0) post-trim = %q, want %q", got, want)
+	}
+}
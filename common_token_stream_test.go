@@ -0,0 +1,248 @@
+package antlr
+
+import "testing"
+
+// testToken is a minimal Token fake: it only implements the methods
+// CommonTokenStream/BufferedTokenStream actually call, which is all a unit
+// test of this package needs from a token.
+type testToken struct {
+	ttype, channel, index int
+	text                  string
+}
+
+func newTestToken(ttype, channel int, text string) *testToken {
+	return &testToken{ttype: ttype, channel: channel, text: text, index: -1}
+}
+
+func (t *testToken) GetTokenType() int   { return t.ttype }
+func (t *testToken) GetChannel() int     { return t.channel }
+func (t *testToken) GetText() string     { return t.text }
+func (t *testToken) SetText(s string)    { t.text = s }
+func (t *testToken) GetTokenIndex() int  { return t.index }
+func (t *testToken) SetTokenIndex(i int) { t.index = i }
+
+// sliceTokenSource is a TokenSource backed by a fixed, pre-built []Token,
+// for tests that want full control over channel/type/text per token
+// without running a real Lexer. It returns a single EOF token forever once
+// the slice is exhausted, matching how a real Lexer behaves at end of
+// input.
+type sliceTokenSource struct {
+	tokens []Token
+	pos    int
+	eof    Token
+}
+
+const testHiddenChannel = LexerDefaultTokenChannel + 1
+
+func newSliceTokenSource(tokens []Token) *sliceTokenSource {
+	return &sliceTokenSource{
+		tokens: tokens,
+		eof:    newTestToken(TokenEOF, LexerDefaultTokenChannel, "<EOF>"),
+	}
+}
+
+func (s *sliceTokenSource) NextToken() Token {
+	if s.pos >= len(s.tokens) {
+		return s.eof
+	}
+	t := s.tokens[s.pos]
+	s.pos++
+	return t
+}
+
+func (s *sliceTokenSource) GetSourceName() string { return "test" }
+
+// newTestCommonTokenStream builds a CommonTokenStream over a fixed slice of
+// tokens. NewCommonTokenStream takes a Lexer, which a sliceTokenSource isn't,
+// so construction goes through SetTokenSource instead - the same seam real
+// callers use to rewind a stream onto a new source.
+func newTestCommonTokenStream(tokens []Token) *CommonTokenStream {
+	cts := NewCommonTokenStream(nil, LexerDefaultTokenChannel)
+	cts.SetTokenSource(newSliceTokenSource(tokens))
+	return cts
+}
+
+func TestCommonTokenStreamLTSkipsOffChannelTokens(t *testing.T) {
+	tokens := []Token{
+		newTestToken(1, testHiddenChannel, " "),
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+		newTestToken(1, testHiddenChannel, " "),
+		newTestToken(3, LexerDefaultTokenChannel, "b"),
+	}
+	cts := newTestCommonTokenStream(tokens)
+
+	if got := cts.LT(1).GetText(); got != "a" {
+		t.Fatalf("LT(1) = %q, want %q", got, "a")
+	}
+	if got := cts.LT(2).GetText(); got != "b" {
+		t.Fatalf("LT(2) = %q, want %q", got, "b")
+	}
+
+	cts.Consume()
+	if got := cts.LB(1).GetText(); got != "a" {
+		t.Fatalf("LB(1) after consuming to b = %q, want %q", got, "a")
+	}
+}
+
+func TestCommonTokenStreamLASkipsOffChannelTokens(t *testing.T) {
+	// Regression test: BufferedTokenStream.LA calls LT on itself, and Go
+	// embedding has no virtual dispatch, so without an LA override on
+	// CommonTokenStream this would return the hidden token's type instead
+	// of going through CommonTokenStream.LT's channel filtering.
+	tokens := []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+		newTestToken(1, testHiddenChannel, " "),
+		newTestToken(3, LexerDefaultTokenChannel, "b"),
+	}
+	cts := newTestCommonTokenStream(tokens)
+
+	if got, want := cts.LA(2), cts.LT(2).GetTokenType(); got != want {
+		t.Fatalf("LA(2) = %d, want %d (LT(2)'s type, the next on-channel token)", got, want)
+	}
+	if got, want := cts.LA(2), 3; got != want {
+		t.Fatalf("LA(2) = %d, want %d (type of on-channel token %q)", got, want, "b")
+	}
+}
+
+func TestCommonTokenStreamAdjustSeekIndexSkipsLeadingHiddenToken(t *testing.T) {
+	tokens := []Token{
+		newTestToken(1, testHiddenChannel, " "),
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+	}
+	cts := newTestCommonTokenStream(tokens)
+
+	if got := cts.Index(); got != -1 {
+		t.Fatalf("Index() before anything triggers lazy init = %d, want -1", got)
+	}
+
+	cts.Seek(0)
+	if got := cts.Index(); got != 1 {
+		t.Fatalf("Index() after Seek(0) = %d, want 1 (first on-channel token)", got)
+	}
+	if got := cts.LT(1).GetText(); got != "a" {
+		t.Fatalf("LT(1) = %q, want %q", got, "a")
+	}
+}
+
+func TestCommonTokenStreamGetHiddenTokensBoundaries(t *testing.T) {
+	// index: 0      1    2      3    4      5
+	//        hidden "a"  hidden "b"  hidden EOF
+	tokens := []Token{
+		newTestToken(1, testHiddenChannel, "pre"),
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+		newTestToken(1, testHiddenChannel, "mid"),
+		newTestToken(2, LexerDefaultTokenChannel, "b"),
+		newTestToken(1, testHiddenChannel, "post"),
+	}
+
+	cases := []struct {
+		name       string
+		tokenIndex int
+		left       bool
+		wantTexts  []string
+	}{
+		{"start-of-file has hidden tokens to the left", 1, true, []string{"pre"}},
+		{"adjacent default tokens have hidden tokens between them", 3, true, []string{"mid"}},
+		{"hidden tokens before EOF are visible to the right", 3, false, []string{"post"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cts := newTestCommonTokenStream(tokens)
+			cts.Fill()
+
+			var got []Token
+			if c.left {
+				got = cts.getHiddenTokensToLeft(c.tokenIndex, -1)
+			} else {
+				got = cts.getHiddenTokensToRight(c.tokenIndex, -1)
+			}
+			if len(got) != len(c.wantTexts) {
+				t.Fatalf("got %d hidden tokens, want %d", len(got), len(c.wantTexts))
+			}
+			for i, want := range c.wantTexts {
+				if got[i].GetText() != want {
+					t.Fatalf("hidden token %d = %q, want %q", i, got[i].GetText(), want)
+				}
+			}
+		})
+	}
+
+	t.Run("start-of-file has no hidden tokens to the left of the first token", func(t *testing.T) {
+		cts := newTestCommonTokenStream(tokens)
+		cts.Fill()
+		if got := cts.getHiddenTokensToLeft(0, -1); got != nil {
+			t.Fatalf("getHiddenTokensToLeft(0) = %v, want nil", got)
+		}
+	})
+}
+
+func TestCommonTokenStreamFillAtPageBoundary(t *testing.T) {
+	const n = 1000 // exactly one fetch() page; exercises the loop's page-rollover
+	tokens := make([]Token, n)
+	for i := range tokens {
+		tokens[i] = newTestToken(2, LexerDefaultTokenChannel, "x")
+	}
+	cts := newTestCommonTokenStream(tokens)
+	cts.Fill()
+
+	all := cts.GetAllTokens()
+	if len(all) != n+1 { // +1 for the trailing EOF token
+		t.Fatalf("GetAllTokens() len = %d, want %d", len(all), n+1)
+	}
+	if all[n].GetTokenType() != TokenEOF {
+		t.Fatalf("last token = %v, want EOF", all[n])
+	}
+}
+
+func TestNewCommonTokenStreamWithTrimmingEnablesTrimming(t *testing.T) {
+	cts := NewCommonTokenStreamWithTrimming(nil, LexerDefaultTokenChannel)
+	cts.SetTokenSource(newSliceTokenSource(nil))
+
+	if !cts.trimEnabled {
+		t.Fatal("NewCommonTokenStreamWithTrimming did not enable trimming")
+	}
+}
+
+func TestBufferedTokenStreamSeekAndGetClampAfterTrim(t *testing.T) {
+	// Regression test: once EnableBufferTrimming has discarded a prefix,
+	// Seek/Get with an index from before the trim must not compute a
+	// negative local() position and panic - they should clamp up to the
+	// oldest token still buffered, same as GetTokens already does.
+	tokens := []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "a"),
+		newTestToken(2, LexerDefaultTokenChannel, "b"),
+		newTestToken(2, LexerDefaultTokenChannel, "c"),
+	}
+	cts := NewCommonTokenStreamWithTrimming(nil, LexerDefaultTokenChannel)
+	cts.SetTokenSource(newSliceTokenSource(tokens))
+
+	marker := cts.Mark()
+	cts.Consume()
+	cts.Consume()
+	cts.Release(marker)
+
+	if cts.bufferStartIndex == 0 {
+		t.Fatal("Release did not trim the buffer; test setup is not exercising the bug")
+	}
+
+	cts.Seek(0)
+	if got := cts.Index(); got != cts.bufferStartIndex {
+		t.Fatalf("Index() after Seek(0) post-trim = %d, want %d (clamped to oldest buffered token)", got, cts.bufferStartIndex)
+	}
+
+	if got, want := cts.Get(0).GetText(), tokens[cts.bufferStartIndex].GetText(); got != want {
+		t.Fatalf("Get(0) after trim = %q, want %q (oldest buffered token)", got, want)
+	}
+}
+
+func TestCommonTokenStreamConsumePanicsAtEOF(t *testing.T) {
+	cts := newTestCommonTokenStream(nil)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Consume() at EOF did not panic")
+		}
+	}()
+	cts.Consume()
+}
@@ -0,0 +1,19 @@
+/* Copyright (c) 2012 The ANTLR Project Contributors. All rights reserved.
+ * Use is of this file is governed by the BSD 3-clause license that
+ * can be found in the LICENSE.txt file in the project root.
+ */
+package antlr
+
+// PARTIAL/BLOCKED - 0% of the requested migration is implemented, and
+// deliberately so: the request is to switch ATNConfig, PredictionContext
+// and SemanticContext identity over to a structural-hash Hasher interface,
+// and rekey ATNConfigSet, closure/reach sets, DFA edge caches and
+// PredictionContextCache on it instead of "shortHashString"/"hashString"
+// concatenation. This tree does not contain ATNConfig.go, ATNConfigSet.go,
+// PredictionContext.go, SemanticContext.go or any of the LL(*) prediction
+// code the request names, so there is nothing here to migrate and no call
+// site that would ever implement or consume a Hasher interface if one were
+// added now. Landing Hasher/HasherSet ahead of that code would just be
+// unused public API sitting in the tree indefinitely, so this item stays
+// a documented blocker instead of speculative scaffolding - leave it open
+// until the ATN prediction code this request names actually lands.
@@ -0,0 +1,409 @@
+/* Copyright (c) 2012 The ANTLR Project Contributors. All rights reserved.
+ * Use is of this file is governed by the BSD 3-clause license that
+ * can be found in the LICENSE.txt file in the project root.
+ */
+package antlr
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	DefaultProgramName = "default"
+	ProgramInitSize    = 100
+	MinTokenIndex      = 0
+)
+
+// RewriteOperation is a single edit queued against a TokenStreamRewriter
+// program: where it anchors, what text it carries, and how to apply itself
+// when the program is rendered.
+type RewriteOperation interface {
+	// Execute writes this operation's contribution to buf and returns the
+	// token index rendering should resume from.
+	Execute(buf *bytes.Buffer) int
+	String() string
+	GetInstructionIndex() int
+	GetIndex() int
+	GetText() string
+	SetText(text string)
+	GetOpName() string
+}
+
+// BaseRewriteOperation carries the state shared by every RewriteOperation
+// and supplies a default String. Its default Execute writes nothing and
+// returns index; every concrete op overrides it.
+type BaseRewriteOperation struct {
+	// instructionIndex is this op's position within the program it was
+	// queued against, used to resolve queue order when reducing rewrites.
+	instructionIndex int
+	// index is the token index this op anchors to.
+	index int
+	// text is the substitution/insertion text; empty for a delete.
+	text string
+	// opName identifies the concrete operation kind for String() and
+	// GetOpName(); reduction does not consult it.
+	opName string
+	tokens *CommonTokenStream
+}
+
+func (op *BaseRewriteOperation) GetInstructionIndex() int { return op.instructionIndex }
+func (op *BaseRewriteOperation) GetIndex() int            { return op.index }
+func (op *BaseRewriteOperation) GetText() string          { return op.text }
+func (op *BaseRewriteOperation) SetText(text string)      { op.text = text }
+func (op *BaseRewriteOperation) GetOpName() string        { return op.opName }
+
+func (op *BaseRewriteOperation) Execute(_ *bytes.Buffer) int {
+	return op.index
+}
+
+func (op *BaseRewriteOperation) String() string {
+	return fmt.Sprintf("<%s@%d:%q>", op.opName, op.index, op.text)
+}
+
+// InsertBeforeOp inserts text immediately before the token at index.
+type InsertBeforeOp struct {
+	BaseRewriteOperation
+}
+
+func NewInsertBeforeOp(tokens *CommonTokenStream, index int, text string) *InsertBeforeOp {
+	return &InsertBeforeOp{BaseRewriteOperation{index: index, text: text, opName: "InsertBeforeOp", tokens: tokens}}
+}
+
+func (op *InsertBeforeOp) Execute(buf *bytes.Buffer) int {
+	buf.WriteString(op.text)
+	if op.tokens.Get(op.index).GetTokenType() != TokenEOF {
+		buf.WriteString(op.tokens.Get(op.index).GetText())
+	}
+	return op.index + 1
+}
+
+// InsertAfterOp inserts text immediately after the token at index. It is
+// implemented as an InsertBeforeOp anchored one token later, so it shares
+// InsertBeforeOp's Execute and reduction behaviour.
+type InsertAfterOp struct {
+	InsertBeforeOp
+}
+
+func NewInsertAfterOp(tokens *CommonTokenStream, index int, text string) *InsertAfterOp {
+	return &InsertAfterOp{InsertBeforeOp{BaseRewriteOperation{index: index + 1, text: text, opName: "InsertAfterOp", tokens: tokens}}}
+}
+
+// ReplaceOp replaces the tokens from index..lastIndex (inclusive) with
+// text. An empty text is a delete.
+type ReplaceOp struct {
+	BaseRewriteOperation
+	lastIndex int
+}
+
+func NewReplaceOp(tokens *CommonTokenStream, from, to int, text string) *ReplaceOp {
+	return &ReplaceOp{
+		BaseRewriteOperation: BaseRewriteOperation{index: from, text: text, opName: "ReplaceOp", tokens: tokens},
+		lastIndex:            to,
+	}
+}
+
+func (op *ReplaceOp) Execute(buf *bytes.Buffer) int {
+	buf.WriteString(op.text)
+	return op.lastIndex + 1
+}
+
+func (op *ReplaceOp) String() string {
+	if op.text == "" {
+		return fmt.Sprintf("<DeleteOp@%d..%d>", op.index, op.lastIndex)
+	}
+	return fmt.Sprintf("<ReplaceOp@%d..%d:%q>", op.index, op.lastIndex, op.text)
+}
+
+// TokenStreamRewriter queues InsertBefore/InsertAfter/Replace/Delete edits
+// against the token indices of an underlying CommonTokenStream and
+// materializes the transformed source text on demand via GetText. Edits are
+// organized into named "programs" so independent rewrite passes (e.g. one
+// per grammar rule) can be composed and rolled back independently; the
+// stream itself is never mutated.
+type TokenStreamRewriter struct {
+	tokens   *CommonTokenStream
+	programs map[string][]RewriteOperation
+}
+
+func NewTokenStreamRewriter(tokens *CommonTokenStream) *TokenStreamRewriter {
+	return &TokenStreamRewriter{
+		tokens:   tokens,
+		programs: map[string][]RewriteOperation{DefaultProgramName: make([]RewriteOperation, 0, ProgramInitSize)},
+	}
+}
+
+func (t *TokenStreamRewriter) GetTokenStream() *CommonTokenStream {
+	return t.tokens
+}
+
+// Rollback discards every instruction queued against the default program at
+// or after instructionIndex.
+func (t *TokenStreamRewriter) Rollback(instructionIndex int) {
+	t.RollbackForProgram(DefaultProgramName, instructionIndex)
+}
+
+func (t *TokenStreamRewriter) RollbackForProgram(programName string, instructionIndex int) {
+	if is, ok := t.programs[programName]; ok {
+		t.programs[programName] = is[MinTokenIndex:instructionIndex]
+	}
+}
+
+// DeleteProgram discards every instruction queued against the default
+// program.
+func (t *TokenStreamRewriter) DeleteProgram() {
+	t.DeleteProgramByName(DefaultProgramName)
+}
+
+func (t *TokenStreamRewriter) DeleteProgramByName(programName string) {
+	t.RollbackForProgram(programName, MinTokenIndex)
+}
+
+func (t *TokenStreamRewriter) InsertAfterDefault(index int, text string) {
+	t.InsertAfter(DefaultProgramName, index, text)
+}
+
+func (t *TokenStreamRewriter) InsertAfterToken(token Token, text string) {
+	t.InsertAfter(DefaultProgramName, token.GetTokenIndex(), text)
+}
+
+func (t *TokenStreamRewriter) InsertAfter(programName string, index int, text string) {
+	op := NewInsertAfterOp(t.tokens, index, text)
+	rewrites := t.getProgram(programName)
+	op.instructionIndex = len(rewrites)
+	t.programs[programName] = append(rewrites, op)
+}
+
+func (t *TokenStreamRewriter) InsertBeforeDefault(index int, text string) {
+	t.InsertBefore(DefaultProgramName, index, text)
+}
+
+func (t *TokenStreamRewriter) InsertBeforeToken(token Token, text string) {
+	t.InsertBefore(DefaultProgramName, token.GetTokenIndex(), text)
+}
+
+func (t *TokenStreamRewriter) InsertBefore(programName string, index int, text string) {
+	op := NewInsertBeforeOp(t.tokens, index, text)
+	rewrites := t.getProgram(programName)
+	op.instructionIndex = len(rewrites)
+	t.programs[programName] = append(rewrites, op)
+}
+
+func (t *TokenStreamRewriter) ReplaceSingleDefault(index int, text string) {
+	t.ReplaceDefault(index, index, text)
+}
+
+func (t *TokenStreamRewriter) ReplaceDefault(from, to int, text string) {
+	t.Replace(DefaultProgramName, from, to, text)
+}
+
+func (t *TokenStreamRewriter) ReplaceToken(from, to Token, text string) {
+	t.Replace(DefaultProgramName, from.GetTokenIndex(), to.GetTokenIndex(), text)
+}
+
+func (t *TokenStreamRewriter) Replace(programName string, from, to int, text string) {
+	if from > to || from < 0 || to < 0 || to >= t.tokens.Size() {
+		panic(fmt.Sprintf("replace: range invalid: %d..%d(size=%d)", from, to, t.tokens.Size()))
+	}
+	op := NewReplaceOp(t.tokens, from, to, text)
+	rewrites := t.getProgram(programName)
+	op.instructionIndex = len(rewrites)
+	t.programs[programName] = append(rewrites, op)
+}
+
+func (t *TokenStreamRewriter) DeleteSingleDefault(index int) {
+	t.ReplaceDefault(index, index, "")
+}
+
+func (t *TokenStreamRewriter) DeleteDefault(from, to int) {
+	t.ReplaceDefault(from, to, "")
+}
+
+func (t *TokenStreamRewriter) Delete(programName string, from, to int) {
+	t.Replace(programName, from, to, "")
+}
+
+func (t *TokenStreamRewriter) getProgram(name string) []RewriteOperation {
+	is, ok := t.programs[name]
+	if !ok {
+		is = make([]RewriteOperation, 0, ProgramInitSize)
+		t.programs[name] = is
+	}
+	return is
+}
+
+// GetTextDefault renders the default program over the whole token stream.
+func (t *TokenStreamRewriter) GetTextDefault() string {
+	return t.GetTextForProgram(DefaultProgramName, NewInterval(0, t.tokens.Size()-1))
+}
+
+// GetText renders the default program over interval.
+func (t *TokenStreamRewriter) GetText(interval *Interval) string {
+	return t.GetTextForProgram(DefaultProgramName, interval)
+}
+
+// GetTextForProgram renders programName's queued edits over interval,
+// emitting untouched tokens verbatim and running each surviving
+// RewriteOperation at the index(es) it covers.
+func (t *TokenStreamRewriter) GetTextForProgram(programName string, interval *Interval) string {
+	rewrites := t.programs[programName]
+	start := interval.start
+	stop := interval.stop
+	if stop > t.tokens.Size()-1 {
+		stop = t.tokens.Size() - 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	// If the stream has trimmed tokens before the requested start (see
+	// BufferedTokenStream.EnableBufferTrimming), render from the oldest
+	// token still buffered instead of indexing into discarded slice
+	// positions.
+	if start < t.tokens.bufferStartIndex {
+		start = t.tokens.bufferStartIndex
+	}
+	if len(rewrites) == 0 {
+		return t.tokens.GetTextFromInterval(interval)
+	}
+
+	var buf bytes.Buffer
+	indexToOp := t.reduceToSingleOperationPerIndex(rewrites)
+
+	i := start
+	for i <= stop && i < t.tokens.Size() {
+		op, ok := indexToOp[i]
+		delete(indexToOp, i)
+		tok := t.tokens.Get(i)
+		if !ok {
+			if tok.GetTokenType() != TokenEOF {
+				buf.WriteString(tok.GetText())
+			}
+			i++
+			continue
+		}
+		i = op.Execute(&buf)
+	}
+
+	// An insert anchored at or past the last token (e.g. InsertAfter on
+	// the final token) never gets visited by the loop above, so flush any
+	// operations left over once we reach the end of the requested range.
+	if stop == t.tokens.Size()-1 {
+		for _, op := range indexToOp {
+			if op.GetIndex() >= t.tokens.Size()-1 {
+				buf.WriteString(op.GetText())
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// reduceToSingleOperationPerIndex resolves a program's queued operations
+// down to at most one RewriteOperation per token index, applying the
+// standard ANTLR overlap rules: an Insert anchored exactly at a Replace's
+// start index is prepended onto the replace's text (regardless of which
+// was queued first), an Insert anchored deeper inside a Replace's range is
+// either absorbed (if queued before the replace) or a programming error
+// (if queued after, since the later insert targets text the replace has
+// already superseded), an earlier Replace fully contained in a later
+// Replace is dropped, and any other overlapping pair of Replaces (including
+// a later Replace nested inside an earlier, wider one) is a programming
+// error. Remaining inserts that land on the same index are concatenated in
+// queue order.
+func (t *TokenStreamRewriter) reduceToSingleOperationPerIndex(rewrites []RewriteOperation) map[int]RewriteOperation {
+	// WALK REPLACES: resolve each replace against every op queued before it.
+	for i, op := range rewrites {
+		rop, ok := op.(*ReplaceOp)
+		if !ok {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			other := rewrites[j]
+			if other == nil {
+				continue
+			}
+			switch prev := other.(type) {
+			case *ReplaceOp:
+				if prev.index >= rop.index && prev.lastIndex <= rop.lastIndex {
+					// Fully contained in rop: the narrower, earlier
+					// replace is a no-op.
+					rewrites[j] = nil
+					continue
+				}
+				disjoint := prev.lastIndex < rop.index || prev.index > rop.lastIndex
+				if !disjoint {
+					panic(fmt.Sprintf("replace op boundaries of %s overlap with previous %s", rop, prev))
+				}
+			default:
+				if other.GetIndex() == rop.index {
+					// An insert anchored at the replace's first token sits
+					// immediately before it, so its text leads.
+					rop.text = other.GetText() + rop.text
+					rewrites[j] = nil
+				} else if other.GetIndex() > rop.index && other.GetIndex() <= rop.lastIndex {
+					// An insert anchored deeper inside the range is
+					// superseded by the replace.
+					rewrites[j] = nil
+				}
+			}
+		}
+	}
+
+	// WALK INSERTS: combine same-index inserts queued earlier, and resolve
+	// against any replace queued before this insert.
+	for i, op := range rewrites {
+		if op == nil {
+			continue
+		}
+		if _, ok := op.(*ReplaceOp); ok {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			other := rewrites[j]
+			if other == nil {
+				continue
+			}
+			if _, ok := other.(*ReplaceOp); ok {
+				continue
+			}
+			// InsertAfterOp is just an InsertBeforeOp anchored one token
+			// later, so two inserts merge whenever they render at the same
+			// index regardless of which "kind" queued them - an
+			// InsertAfter(i) and an InsertBefore(i+1) land on the same
+			// boundary and must combine instead of both surviving to the
+			// one-op-per-index map below.
+			if other.GetIndex() == op.GetIndex() {
+				op.SetText(other.GetText() + op.GetText())
+				rewrites[j] = nil
+			}
+		}
+
+		for j := 0; j < i; j++ {
+			rop, ok := rewrites[j].(*ReplaceOp)
+			if !ok {
+				continue
+			}
+			if op.GetIndex() == rop.index {
+				rop.text = op.GetText() + rop.text
+				rewrites[i] = nil
+				break
+			} else if op.GetIndex() > rop.index && op.GetIndex() <= rop.lastIndex {
+				panic(fmt.Sprintf("insert op %s within boundaries of previous %s", op, rop))
+			}
+		}
+	}
+
+	m := make(map[int]RewriteOperation)
+	for _, op := range rewrites {
+		if op == nil {
+			continue
+		}
+		if _, exists := m[op.GetIndex()]; exists {
+			panic("should only be one op per index")
+		}
+		m[op.GetIndex()] = op
+	}
+	return m
+}
@@ -0,0 +1,143 @@
+package antlr
+
+import "testing"
+
+// newTestRewriter builds a TokenStreamRewriter over a fixed slice of tokens,
+// filling the underlying stream first so Size() (and therefore Replace's
+// range check) sees the whole token count rather than just what's been
+// lazily fetched.
+func newTestRewriter(tokens []Token) *TokenStreamRewriter {
+	cts := newTestCommonTokenStream(tokens)
+	cts.Fill()
+	return NewTokenStreamRewriter(cts)
+}
+
+func threeLetterTokens() []Token {
+	return []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "A"),
+		newTestToken(2, LexerDefaultTokenChannel, "B"),
+		newTestToken(2, LexerDefaultTokenChannel, "C"),
+	}
+}
+
+func TestTokenStreamRewriterInsertBeforeAtReplaceStartIsPrepended(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.InsertBeforeDefault(1, "X")
+	r.ReplaceDefault(1, 2, "Y")
+
+	if got, want := r.GetTextDefault(), "AXY"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterReplaceThenInsertAtStartIsPrepended(t *testing.T) {
+	// Same overlap as above, but the replace is queued first: the insert
+	// still has to land immediately in front of the replace's text.
+	r := newTestRewriter(threeLetterTokens())
+	r.ReplaceDefault(1, 2, "Y")
+	r.InsertBeforeDefault(1, "X")
+
+	if got, want := r.GetTextDefault(), "AXY"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterInsertInsideReplaceRangeIsAbsorbed(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.InsertBeforeDefault(2, "X")
+	r.ReplaceDefault(1, 2, "Y")
+
+	if got, want := r.GetTextDefault(), "AY"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterInsertInsideReplaceRangeAfterPanics(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.ReplaceDefault(1, 2, "Y")
+	r.InsertBeforeDefault(2, "X")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("GetTextDefault() did not panic on insert inside an earlier replace's range")
+		}
+	}()
+	r.GetTextDefault()
+}
+
+func TestTokenStreamRewriterDeleteRendersEmptyRange(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.DeleteDefault(1, 2)
+
+	if got, want := r.GetTextDefault(), "A"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterNestedReplaceIsAbsorbed(t *testing.T) {
+	// A replace fully contained in a later, wider replace is superseded.
+	r := newTestRewriter(threeLetterTokens())
+	r.ReplaceSingleDefault(1, "inner")
+	r.ReplaceDefault(0, 2, "outer")
+
+	if got, want := r.GetTextDefault(), "outer"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterOverlappingDisjointReplacesPanic(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.ReplaceDefault(0, 1, "X")
+	r.ReplaceDefault(1, 2, "Y")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("GetTextDefault() did not panic on overlapping, non-nested replaces")
+		}
+	}()
+	r.GetTextDefault()
+}
+
+func TestTokenStreamRewriterRollbackDiscardsQueuedOps(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.InsertBeforeDefault(0, "X")
+	mark := len(r.getProgram(DefaultProgramName))
+	r.ReplaceDefault(1, 2, "Y")
+	r.Rollback(mark)
+
+	if got, want := r.GetTextDefault(), "XABC"; got != want {
+		t.Fatalf("GetTextDefault() after Rollback = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterInsertAfterAndInsertBeforeAtSameBoundaryMerge(t *testing.T) {
+	// Regression test: InsertAfter(0, ...) renders at index 1, same as
+	// InsertBefore(1, ...), but the two ops have different GetOpName()s.
+	// reduceToSingleOperationPerIndex used to only merge same-index inserts
+	// that also shared an op name, so these two non-overlapping calls left
+	// both inserts anchored at index 1 and tripped the "should only be one
+	// op per index" panic instead of combining in queue order.
+	r := newTestRewriter(threeLetterTokens())
+	r.InsertAfterDefault(0, "X")
+	r.InsertBeforeDefault(1, "Y")
+
+	if got, want := r.GetTextDefault(), "AXYBC"; got != want {
+		t.Fatalf("GetTextDefault() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenStreamRewriterProgramsAreIndependent(t *testing.T) {
+	r := newTestRewriter(threeLetterTokens())
+	r.InsertBefore("first", 0, "X")
+	r.Replace("second", 1, 2, "Y")
+
+	if got, want := r.GetTextForProgram("first", NewInterval(0, 2)), "XABC"; got != want {
+		t.Fatalf("program %q = %q, want %q", "first", got, want)
+	}
+	if got, want := r.GetTextForProgram("second", NewInterval(0, 2)), "AY"; got != want {
+		t.Fatalf("program %q = %q, want %q", "second", got, want)
+	}
+	if got, want := r.GetTextDefault(), "ABC"; got != want {
+		t.Fatalf("default program = %q, want %q (should be untouched by other programs)", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+/* Copyright (c) 2012 The ANTLR Project Contributors. All rights reserved.
+ * Use is of this file is governed by the BSD 3-clause license that
+ * can be found in the LICENSE.txt file in the project root.
+ */
+package antlr
+
+import "fmt"
+
+// UnbufferedDefaultWindowSize is how many tokens UnbufferedTokenStream
+// reserves capacity for up front; the window grows past this while a Mark
+// is outstanding and keeps older tokens alive.
+const UnbufferedDefaultWindowSize = 100
+
+// UnbufferedTokenStream is a TokenStream that keeps only a sliding window
+// of tokens around the current position instead of buffering the whole
+// input like CommonTokenStream.Fill does. It is meant for parsers reading
+// from a network or pipe source, where fetching every token up front would
+// block or exhaust memory.
+//
+// LT(k) for k>0 fetches tokens on demand. LT(k) for k<0 (look-behind) is
+// only permitted while a Mark covers the requested index; once the
+// matching Release runs with no other Mark outstanding, every token behind
+// the current position is discarded and look-behind past that point
+// panics. Seek is likewise restricted to indices still inside the live
+// window.
+type UnbufferedTokenStream struct {
+	tokenSource TokenSource
+
+	// tokens is the live window; tokens[0] holds the token at
+	// windowStartIndex.
+	tokens []Token
+	// windowStartIndex is the absolute token index of tokens[0].
+	windowStartIndex int
+	// p is the absolute index of the current token (LT(1)).
+	p int
+
+	fetchedEOF bool
+
+	// markDepth counts outstanding Mark calls. Tokens behind the current
+	// position are only discarded once it drops back to zero.
+	markDepth  int
+	nextMarker int
+	// markStart is the absolute index LT(k<0) may not look behind while a
+	// Mark is outstanding.
+	markStart int
+}
+
+func NewUnbufferedTokenStream(tokenSource TokenSource) *UnbufferedTokenStream {
+	return &UnbufferedTokenStream{
+		tokenSource: tokenSource,
+		tokens:      make([]Token, 0, UnbufferedDefaultWindowSize),
+		markStart:   -1,
+	}
+}
+
+func (u *UnbufferedTokenStream) local(i int) int { return i - u.windowStartIndex }
+
+// fill grows the window until at least want tokens are available at and
+// after the current position, or EOF has been fetched.
+func (u *UnbufferedTokenStream) fill(want int) {
+	for !u.fetchedEOF && len(u.tokens)-u.local(u.p) < want {
+		t := u.tokenSource.NextToken()
+		t.SetTokenIndex(u.windowStartIndex + len(u.tokens))
+		u.tokens = append(u.tokens, t)
+		if t.GetTokenType() == TokenEOF {
+			u.fetchedEOF = true
+		}
+	}
+}
+
+func (u *UnbufferedTokenStream) LA(i int) int {
+	return u.LT(i).GetTokenType()
+}
+
+func (u *UnbufferedTokenStream) LT(k int) Token {
+	if k == 0 {
+		return nil
+	}
+	if k < 0 {
+		return u.lookBehind(-k)
+	}
+	u.fill(k)
+	idx := u.local(u.p) + k - 1
+	if idx >= len(u.tokens) {
+		// Ran off the fetched window without seeing k tokens: the source
+		// hit EOF first, so the last token buffered is EOF.
+		return u.tokens[len(u.tokens)-1]
+	}
+	return u.tokens[idx]
+}
+
+func (u *UnbufferedTokenStream) lookBehind(k int) Token {
+	if u.markDepth == 0 || u.p-k < u.markStart {
+		panic("cannot look backwards past the start of the active Mark")
+	}
+	return u.tokens[u.local(u.p-k)]
+}
+
+func (u *UnbufferedTokenStream) Get(index int) Token {
+	idx := u.local(index)
+	if idx < 0 || idx >= len(u.tokens) {
+		panic(fmt.Sprintf("token index %d is outside the live window", index))
+	}
+	return u.tokens[idx]
+}
+
+func (u *UnbufferedTokenStream) Consume() {
+	if u.LA(1) == TokenEOF {
+		panic("cannot consume EOF")
+	}
+	u.p++
+	u.fill(1)
+	u.discardBehindMark()
+}
+
+// discardBehindMark drops the prefix of the window behind the current
+// position once no outstanding Mark still needs it.
+func (u *UnbufferedTokenStream) discardBehindMark() {
+	if u.markDepth > 0 {
+		return
+	}
+	cut := u.local(u.p)
+	if cut <= 0 {
+		return
+	}
+	u.tokens = append(u.tokens[:0:0], u.tokens[cut:]...)
+	u.windowStartIndex += cut
+}
+
+func (u *UnbufferedTokenStream) Mark() int {
+	if u.markDepth == 0 {
+		u.markStart = u.p
+	}
+	u.markDepth++
+	u.nextMarker++
+	return u.nextMarker
+}
+
+// Release balances a prior Mark. An unbalanced Release (no outstanding
+// Mark) is a no-op rather than a panic, matching
+// BufferedTokenStream.Release: real Parser/ATN call sites are not
+// exhaustively audited against this refactor, so a stray Release should be
+// harmless here too rather than crashing a caller that happens to
+// over-release.
+func (u *UnbufferedTokenStream) Release(marker int) {
+	if u.markDepth == 0 {
+		return
+	}
+	u.markDepth--
+	if u.markDepth == 0 {
+		u.markStart = -1
+		u.discardBehindMark()
+	}
+}
+
+// Seek moves the current position to index, which must already be inside
+// the live window (or be the next token, which is fetched on demand).
+func (u *UnbufferedTokenStream) Seek(index int) {
+	idx := u.local(index)
+	if idx < 0 || idx > len(u.tokens) {
+		panic(fmt.Sprintf("seek index %d is outside the live window", index))
+	}
+	u.p = index
+	if idx == len(u.tokens) {
+		// fill must see the target position, not the one Seek is leaving,
+		// or it fetches against the wrong index and LT(1) mistakes the
+		// stale last buffered token for EOF (see Consume, which does the
+		// same p-then-fill ordering).
+		u.fill(1)
+	}
+}
+
+func (u *UnbufferedTokenStream) Index() int {
+	return u.p
+}
+
+// Size is not knowable for an unbuffered stream without reading it to EOF,
+// which defeats the point of using one.
+func (u *UnbufferedTokenStream) Size() int {
+	panic("size is unknown for an UnbufferedTokenStream")
+}
+
+func (u *UnbufferedTokenStream) GetSourceName() string {
+	return u.tokenSource.GetSourceName()
+}
+
+func (u *UnbufferedTokenStream) GetTokenSource() TokenSource {
+	return u.tokenSource
+}
+
+// GetTextFromInterval returns the text of the tokens in interval, which
+// must lie entirely inside the live window.
+func (u *UnbufferedTokenStream) GetTextFromInterval(interval *Interval) string {
+	start := u.local(interval.start)
+	stop := u.local(interval.stop)
+	if start < 0 || stop >= len(u.tokens) {
+		panic("requested interval falls outside the live window")
+	}
+	s := ""
+	for i := start; i <= stop; i++ {
+		t := u.tokens[i]
+		if t.GetTokenType() == TokenEOF {
+			break
+		}
+		s += t.GetText()
+	}
+	return s
+}
+
+var _ IntStream = (*UnbufferedTokenStream)(nil)
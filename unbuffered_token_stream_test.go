@@ -0,0 +1,141 @@
+package antlr
+
+import "testing"
+
+func newTestUnbufferedTokenStream(tokens []Token) *UnbufferedTokenStream {
+	return NewUnbufferedTokenStream(newSliceTokenSource(tokens))
+}
+
+func fourLetterTokens() []Token {
+	return []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "A"),
+		newTestToken(2, LexerDefaultTokenChannel, "B"),
+		newTestToken(2, LexerDefaultTokenChannel, "C"),
+		newTestToken(2, LexerDefaultTokenChannel, "D"),
+	}
+}
+
+func TestUnbufferedTokenStreamLTFetchesOnDemand(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+
+	if got, want := u.LT(1).GetText(), "A"; got != want {
+		t.Fatalf("LT(1) = %q, want %q", got, want)
+	}
+	if got, want := u.LT(3).GetText(), "C"; got != want {
+		t.Fatalf("LT(3) = %q, want %q", got, want)
+	}
+}
+
+func TestUnbufferedTokenStreamLTPastEOFReturnsEOF(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+
+	if got := u.LT(10).GetTokenType(); got != TokenEOF {
+		t.Fatalf("LT(10) type = %d, want TokenEOF", got)
+	}
+}
+
+func TestUnbufferedTokenStreamConsumeDiscardsWindowBehind(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+	u.Consume()
+	u.Consume()
+
+	if u.windowStartIndex == 0 {
+		t.Fatal("Consume did not discard the window behind the current position; test setup is not exercising the behavior")
+	}
+	if got, want := u.LT(1).GetText(), "C"; got != want {
+		t.Fatalf("LT(1) after two Consume = %q, want %q", got, want)
+	}
+}
+
+func TestUnbufferedTokenStreamLookBehindPanicsWithoutMark(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+	u.Consume()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("LT(-1) without an outstanding Mark did not panic")
+		}
+	}()
+	u.LT(-1)
+}
+
+func TestUnbufferedTokenStreamMarkAllowsLookBehindThenReleaseDiscards(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+
+	// Mark before consuming anything, so the window behind the current
+	// position is protected from discard for as long as the Mark is live.
+	marker := u.Mark()
+	u.Consume()
+	if got, want := u.LT(-1).GetText(), "A"; got != want {
+		t.Fatalf("LT(-1) under an active Mark = %q, want %q", got, want)
+	}
+
+	u.Consume()
+	u.Release(marker)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("LT(-1) after Release discarded the window did not panic")
+		}
+	}()
+	u.LT(-1)
+}
+
+func TestUnbufferedTokenStreamGetOutsideWindowPanics(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+	u.Consume()
+	u.Consume()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Get() of an index discarded from the window did not panic")
+		}
+	}()
+	u.Get(0)
+}
+
+func TestUnbufferedTokenStreamSeekOutsideWindowPanics(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+	u.Consume()
+	u.Consume()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Seek() to an index discarded from the window did not panic")
+		}
+	}()
+	u.Seek(0)
+}
+
+func TestUnbufferedTokenStreamSeekToFetchBoundaryFetchesForwardPosition(t *testing.T) {
+	// Regression test: Seek to the boundary token (idx == len(tokens)) must
+	// set u.p to the target index before calling fill, not after - fill
+	// computes how many more tokens are needed relative to u.p, so fetching
+	// against the old position silently fetches nothing and a later LT(1)
+	// mistakes the stale last buffered token for EOF even though the
+	// source has a real token (and isn't at EOF) waiting to be fetched.
+	tokens := []Token{
+		newTestToken(2, LexerDefaultTokenChannel, "A"),
+		newTestToken(2, LexerDefaultTokenChannel, "B"),
+		newTestToken(2, LexerDefaultTokenChannel, "C"),
+		newTestToken(2, LexerDefaultTokenChannel, "D"),
+	}
+	u := newTestUnbufferedTokenStream(tokens)
+	u.LT(3) // fetches A, B, C into the window; p is still 0
+
+	u.Seek(3)
+	if got, want := u.LT(1).GetText(), "D"; got != want {
+		t.Fatalf("LT(1) after Seek to the fetch boundary = %q, want %q", got, want)
+	}
+}
+
+func TestUnbufferedTokenStreamSizePanics(t *testing.T) {
+	u := newTestUnbufferedTokenStream(fourLetterTokens())
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Size() did not panic; it is meant to be unknowable for an unbuffered stream")
+		}
+	}()
+	u.Size()
+}